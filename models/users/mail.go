@@ -0,0 +1,21 @@
+package users
+
+import "context"
+
+// Mailer delivers the e-mails the token subsystem sends. Plug in SES, SMTP,
+// or NoopMailer for tests.
+type Mailer interface {
+	SendVerificationEmail(ctx context.Context, uid, token string) error
+	SendPasswordResetEmail(ctx context.Context, uid, token string) error
+}
+
+// NoopMailer discards every message.
+type NoopMailer struct{}
+
+func (NoopMailer) SendVerificationEmail(ctx context.Context, uid, token string) error {
+	return nil
+}
+
+func (NoopMailer) SendPasswordResetEmail(ctx context.Context, uid, token string) error {
+	return nil
+}
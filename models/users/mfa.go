@@ -0,0 +1,370 @@
+package users
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/alonsovidales/pit/models/users/store"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	CActivityMFAType = "mfa"
+
+	cMFAIssuer          = "pit"
+	cMFAChallengeTTL    = 2 * time.Minute
+	cMFAWindowSkew      = 1
+	cMFAUsedWindowsKept = 5
+	cMFARecoveryCodes   = 8
+	cMFARecoveryBytes   = 5
+
+	cHKDFInfoMFASecret = "pit-mfa-secret-v1"
+)
+
+var (
+	ErrMFANotEnrolled = errors.New("users: TOTP is not enrolled for this user")
+	ErrInvalidMFACode = errors.New("users: invalid MFA code")
+)
+
+func (us *User) EnrollTOTP(ctx context.Context) (secret string, otpauthURL string, err error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      cMFAIssuer,
+		AccountName: us.uid,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	enc, err := us.md.encryptMFASecret(key.Secret())
+	if err != nil {
+		return "", "", err
+	}
+
+	us.mfaSecretEnc = enc
+	us.mfaEnabled = false
+	us.mfaUsedWindows = nil
+	us.mfaRecoveryHashes = nil
+
+	if !us.persist(ctx) {
+		return "", "", errors.New("Error trying to store the user data")
+	}
+	us.AddActivityLog(ctx, CActivityMFAType, "TOTP enrollment started", "")
+
+	return key.Secret(), key.String(), nil
+}
+
+// Recovery codes are only ever available here, in plaintext, once - only
+// their hash is persisted.
+func (us *User) ConfirmTOTP(ctx context.Context, code string) (recoveryCodes []string, err error) {
+	if us.mfaSecretEnc == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	secret, err := us.md.decryptMFASecret(us.mfaSecretEnc)
+	if err != nil {
+		return nil, err
+	}
+	window, ok := us.md.validateTOTPCode(secret, code, nil)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	recoveryCodes, hashes, err := us.md.generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	us.mfaEnabled = true
+	us.mfaRecoveryHashes = hashes
+	// Record the confirm code's window too, so it can't be replayed.
+	us.mfaUsedWindows = appendUsedWindow(us.mfaUsedWindows, window)
+
+	if !us.persist(ctx) {
+		return nil, errors.New("Error trying to store the user data")
+	}
+	us.AddActivityLog(ctx, CActivityMFAType, "TOTP enabled", "")
+
+	return recoveryCodes, nil
+}
+
+func (us *User) DisableTOTP(ctx context.Context, code string) error {
+	if !us.mfaEnabled {
+		return ErrMFANotEnrolled
+	}
+
+	secret, err := us.md.decryptMFASecret(us.mfaSecretEnc)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := us.md.validateTOTPCode(secret, code, us.mfaUsedWindows); !ok {
+		if !us.consumeRecoveryCode(code) {
+			return ErrInvalidMFACode
+		}
+	}
+
+	us.mfaSecretEnc = ""
+	us.mfaEnabled = false
+	us.mfaUsedWindows = nil
+	us.mfaRecoveryHashes = nil
+
+	if !us.persist(ctx) {
+		return errors.New("Error trying to store the user data")
+	}
+	us.AddActivityLog(ctx, CActivityMFAType, "TOTP disabled", "")
+
+	return nil
+}
+
+func (um *Model) VerifyMFA(ctx context.Context, uid, challenge, code string) (user *User) {
+	challengeUID, err := um.consumeToken(ctx, challenge, store.TokenPurposeMFAChallenge)
+	if err != nil || challengeUID != uid {
+		return nil
+	}
+
+	user = um.getUserByID(ctx, uid, true)
+	if user == nil || !user.mfaEnabled {
+		return nil
+	}
+
+	secret, err := um.decryptMFASecret(user.mfaSecretEnc)
+	if err != nil {
+		return nil
+	}
+
+	window, ok := um.validateTOTPCode(secret, code, user.mfaUsedWindows)
+	if !ok {
+		return nil
+	}
+
+	user.mfaUsedWindows = appendUsedWindow(user.mfaUsedWindows, window)
+	user.persist(ctx)
+	user.AddActivityLog(ctx, CActivityMFAType, "Logged in with TOTP", "")
+
+	return user
+}
+
+func (um *Model) VerifyRecoveryCode(ctx context.Context, uid, challenge, code string) (user *User) {
+	challengeUID, err := um.consumeToken(ctx, challenge, store.TokenPurposeMFAChallenge)
+	if err != nil || challengeUID != uid {
+		return nil
+	}
+
+	user = um.getUserByID(ctx, uid, true)
+	if user == nil || !user.mfaEnabled {
+		return nil
+	}
+
+	if !user.consumeRecoveryCode(code) {
+		return nil
+	}
+
+	user.persist(ctx)
+	user.AddActivityLog(ctx, CActivityMFAType, "Logged in with a recovery code", "")
+
+	return user
+}
+
+func (um *Model) issueMFAChallenge(ctx context.Context, uid string) (challenge string, err error) {
+	raw := make([]byte, cTokenBytes)
+	if _, err = rand.Read(raw); err != nil {
+		return "", err
+	}
+	challenge = hex.EncodeToString(raw)
+
+	if err = um.tokens.Put(ctx, store.Token{
+		Hash:    hashToken(challenge),
+		UID:     uid,
+		Purpose: store.TokenPurposeMFAChallenge,
+		TTL:     time.Now().Add(cMFAChallengeTTL).Unix(),
+	}); err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+func (us *User) consumeRecoveryCode(code string) bool {
+	hash := us.md.HashPassword(code)
+	for i, h := range us.mfaRecoveryHashes {
+		if h == hash {
+			us.mfaRecoveryHashes = append(us.mfaRecoveryHashes[:i], us.mfaRecoveryHashes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (um *Model) generateRecoveryCodes() (plain []string, hashed []string, err error) {
+	plain = make([]string, cMFARecoveryCodes)
+	hashed = make([]string, cMFARecoveryCodes)
+
+	for i := range plain {
+		raw := make([]byte, cMFARecoveryBytes)
+		if _, err = rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		plain[i] = hex.EncodeToString(raw)
+		hashed[i] = um.HashPassword(plain[i])
+	}
+
+	return plain, hashed, nil
+}
+
+// validateTOTPCode also rejects any window already in usedWindows, to
+// prevent replay, and returns the matched window so the caller can record it.
+func (um *Model) validateTOTPCode(secret, code string, usedWindows []int64) (window int64, ok bool) {
+	const period = 30
+	now := time.Now().Unix() / period
+
+	for skew := int64(-cMFAWindowSkew); skew <= cMFAWindowSkew; skew++ {
+		candidate := now + skew
+		generated, err := hotp.GenerateCodeCustom(secret, uint64(candidate), hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			continue
+		}
+		if generated != code {
+			continue
+		}
+		if isUsedWindow(usedWindows, candidate) {
+			return 0, false
+		}
+		return candidate, true
+	}
+
+	return 0, false
+}
+
+func isUsedWindow(usedWindows []int64, window int64) bool {
+	for _, w := range usedWindows {
+		if w == window {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUsedWindow(usedWindows []int64, window int64) []int64 {
+	usedWindows = append(usedWindows, window)
+	if len(usedWindows) > cMFAUsedWindowsKept {
+		usedWindows = usedWindows[len(usedWindows)-cMFAUsedWindowsKept:]
+	}
+	return usedWindows
+}
+
+func (um *Model) encryptMFASecret(secret string) (string, error) {
+	key, err := um.mfaEncryptionKey()
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+func (um *Model) decryptMFASecret(enc string) (string, error) {
+	key, err := um.mfaEncryptionKey()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return "", fmt.Errorf("users: malformed MFA secret")
+	}
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
+
+func (um *Model) mfaEncryptionKey() ([]byte, error) {
+	h := hkdf.New(sha256.New, um.secret, nil, []byte(cHKDFInfoMFASecret))
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(h, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func marshalUsedWindows(windows []int64) string {
+	if len(windows) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(windows)
+	return string(data)
+}
+
+func unmarshalUsedWindows(data string) []int64 {
+	if data == "" {
+		return nil
+	}
+	var windows []int64
+	_ = json.Unmarshal([]byte(data), &windows)
+	return windows
+}
+
+func marshalRecoveryHashes(hashes []string) string {
+	if len(hashes) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(hashes)
+	return string(data)
+}
+
+func unmarshalRecoveryHashes(data string) []string {
+	if data == "" {
+		return nil
+	}
+	var hashes []string
+	_ = json.Unmarshal([]byte(data), &hashes)
+	return hashes
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var boltActivityBucket = []byte("activity")
+
+// BoltActivityStore is an embedded ActivityStore backed by a BoltDB file.
+// Entries are keyed by "<uid>\x00<ts>" so a bucket cursor walks a user's
+// activity in ts order; Bolt has no native TTL, so expiry isn't enforced.
+type BoltActivityStore struct {
+	db        *bbolt.DB
+	retention time.Duration
+}
+
+func NewBoltActivityStore(path string, retention time.Duration) (*BoltActivityStore, error) {
+	db, err := openBoltDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltActivityStore{db: db, retention: retention}, nil
+}
+
+func boltActivityKey(uid string, ts int64) []byte {
+	return []byte(fmt.Sprintf("%s\x00%020d", uid, ts))
+}
+
+func (bs *BoltActivityStore) Append(ctx context.Context, entry ActivityEntry) error {
+	return bs.AppendBatch(ctx, []ActivityEntry{entry})
+}
+
+func (bs *BoltActivityStore) AppendBatch(ctx context.Context, entries []ActivityEntry) error {
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(boltActivityBucket)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if entry.TTL == 0 && bs.retention > 0 {
+				entry.TTL = time.Unix(entry.Ts, 0).Add(bs.retention).Unix()
+			}
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err = bucket.Put(boltActivityKey(entry.UID, entry.Ts), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bs *BoltActivityStore) Query(ctx context.Context, uid, typeFilter string, limit int32, cursor string) (entries []ActivityEntry, nextCursor string, err error) {
+	prefix := []byte(uid + "\x00")
+	start := prefix
+	if cursor != "" {
+		raw, decErr := base64.URLEncoding.DecodeString(cursor)
+		if decErr != nil {
+			return nil, "", decErr
+		}
+		start = raw
+	}
+
+	err = bs.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltActivityBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if cursor != "" && string(k) == string(start) {
+				continue
+			}
+			var entry ActivityEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if typeFilter != "" && entry.Type != typeFilter {
+				continue
+			}
+			entries = append(entries, entry)
+			if int32(len(entries)) == limit {
+				nextCursor = base64.URLEncoding.EncodeToString(k)
+				break
+			}
+		}
+		return nil
+	})
+
+	return entries, nextCursor, err
+}
+
+func (bs *BoltActivityStore) QueryByType(ctx context.Context, activityType string, limit int32, cursor string) (entries []ActivityEntry, nextCursor string, err error) {
+	start := []byte{}
+	if cursor != "" {
+		raw, decErr := base64.URLEncoding.DecodeString(cursor)
+		if decErr != nil {
+			return nil, "", decErr
+		}
+		start = raw
+	}
+
+	err = bs.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltActivityBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek(start); k != nil; k, v = c.Next() {
+			if cursor != "" && string(k) == string(start) {
+				continue
+			}
+			var entry ActivityEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if entry.Type != activityType {
+				continue
+			}
+			entries = append(entries, entry)
+			if int32(len(entries)) == limit {
+				nextCursor = base64.URLEncoding.EncodeToString(k)
+				break
+			}
+		}
+		return nil
+	})
+
+	return entries, nextCursor, err
+}
+
+func (bs *BoltActivityStore) EnsureReady(ctx context.Context) error {
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltActivityBucket)
+		return err
+	})
+}
@@ -0,0 +1,298 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	cActivityTable     = "activity"
+	cActivityHashKey   = "uid"
+	cActivityRangeKey  = "ts"
+	cActivityTTLAttr   = "ttl"
+	cActivityTypeIndex = "type-ts-index"
+	cActivityBatchSize = 25
+)
+
+type activityItem struct {
+	UID  string `dynamodbav:"uid"`
+	Ts   int64  `dynamodbav:"ts"`
+	Type string `dynamodbav:"type"`
+	Ip   string `dynamodbav:"ip"`
+	Desc string `dynamodbav:"desc"`
+	TTL  int64  `dynamodbav:"ttl"`
+}
+
+// DynamoDBActivityStore is the production ActivityStore, keyed by
+// (uid HASH, ts RANGE) with a (type, ts) GSI for cross-user queries.
+type DynamoDBActivityStore struct {
+	tableName string
+	retention time.Duration
+	conn      *dynamodb.Client
+}
+
+func NewDynamoDBActivityStore(ctx context.Context, prefix, awsRegion, endpoint string, retention time.Duration) (*DynamoDBActivityStore, error) {
+	awsCfg, err := loadAWSConfig(ctx, awsRegion, endpoint)
+	if err != nil {
+		log.Error("Problem trying to connect with DynamoDB, Error:", err)
+		return nil, err
+	}
+
+	return &DynamoDBActivityStore{
+		tableName: fmt.Sprintf("%s_%s", prefix, cActivityTable),
+		retention: retention,
+		conn:      dynamodb.NewFromConfig(awsCfg),
+	}, nil
+}
+
+func (as *DynamoDBActivityStore) Append(ctx context.Context, entry ActivityEntry) error {
+	item, err := attributevalue.MarshalMap(toActivityItem(entry, as.retention))
+	if err != nil {
+		return err
+	}
+
+	_, err = as.conn.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(as.tableName),
+		Item:      item,
+	})
+	return err
+}
+
+func (as *DynamoDBActivityStore) AppendBatch(ctx context.Context, entries []ActivityEntry) error {
+	for start := 0; start < len(entries); start += cActivityBatchSize {
+		end := start + cActivityBatchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		writeReqs := make([]types.WriteRequest, 0, end-start)
+		for _, entry := range entries[start:end] {
+			item, err := attributevalue.MarshalMap(toActivityItem(entry, as.retention))
+			if err != nil {
+				return err
+			}
+			writeReqs = append(writeReqs, types.WriteRequest{
+				PutRequest: &types.PutRequest{Item: item},
+			})
+		}
+
+		if _, err := as.conn.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{as.tableName: writeReqs},
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (as *DynamoDBActivityStore) Query(ctx context.Context, uid, typeFilter string, limit int32, cursor string) (entries []ActivityEntry, nextCursor string, err error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(as.tableName),
+		KeyConditionExpression: aws.String("#uid = :uid"),
+		ExpressionAttributeNames: map[string]string{
+			"#uid": cActivityHashKey,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid": &types.AttributeValueMemberS{Value: uid},
+		},
+		Limit: aws.Int32(limit),
+	}
+	if typeFilter != "" {
+		input.FilterExpression = aws.String("#type = :type")
+		input.ExpressionAttributeNames["#type"] = "type"
+		input.ExpressionAttributeValues[":type"] = &types.AttributeValueMemberS{Value: typeFilter}
+	}
+	if input.ExclusiveStartKey, err = decodeCursor(cursor); err != nil {
+		return nil, "", err
+	}
+
+	out, err := as.conn.Query(ctx, input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var items []activityItem
+	if err = attributevalue.UnmarshalListOfMaps(out.Items, &items); err != nil {
+		return nil, "", err
+	}
+	for _, item := range items {
+		entries = append(entries, fromActivityItem(item))
+	}
+
+	if nextCursor, err = encodeCursor(out.LastEvaluatedKey); err != nil {
+		return nil, "", err
+	}
+	return entries, nextCursor, nil
+}
+
+func (as *DynamoDBActivityStore) QueryByType(ctx context.Context, activityType string, limit int32, cursor string) (entries []ActivityEntry, nextCursor string, err error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(as.tableName),
+		IndexName:              aws.String(cActivityTypeIndex),
+		KeyConditionExpression: aws.String("#type = :type"),
+		ExpressionAttributeNames: map[string]string{
+			"#type": "type",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":type": &types.AttributeValueMemberS{Value: activityType},
+		},
+		Limit: aws.Int32(limit),
+	}
+	if input.ExclusiveStartKey, err = decodeCursor(cursor); err != nil {
+		return nil, "", err
+	}
+
+	out, err := as.conn.Query(ctx, input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var items []activityItem
+	if err = attributevalue.UnmarshalListOfMaps(out.Items, &items); err != nil {
+		return nil, "", err
+	}
+	for _, item := range items {
+		entries = append(entries, fromActivityItem(item))
+	}
+
+	if nextCursor, err = encodeCursor(out.LastEvaluatedKey); err != nil {
+		return nil, "", err
+	}
+	return entries, nextCursor, nil
+}
+
+func (as *DynamoDBActivityStore) EnsureReady(ctx context.Context) error {
+	_, err := as.conn.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(as.tableName),
+	})
+	if err != nil {
+		if !isTableNotFound(err) {
+			log.Error("Can't describe Dynamo DB instances table, Error:", err)
+			return err
+		}
+
+		log.Info("Creating a new table on DynamoDB:", as.tableName)
+		_, err = as.conn.CreateTable(ctx, &dynamodb.CreateTableInput{
+			TableName: aws.String(as.tableName),
+			AttributeDefinitions: []types.AttributeDefinition{
+				{AttributeName: aws.String(cActivityHashKey), AttributeType: types.ScalarAttributeTypeS},
+				{AttributeName: aws.String(cActivityRangeKey), AttributeType: types.ScalarAttributeTypeN},
+				{AttributeName: aws.String("type"), AttributeType: types.ScalarAttributeTypeS},
+			},
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String(cActivityHashKey), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String(cActivityRangeKey), KeyType: types.KeyTypeRange},
+			},
+			GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+				{
+					IndexName: aws.String(cActivityTypeIndex),
+					KeySchema: []types.KeySchemaElement{
+						{AttributeName: aws.String("type"), KeyType: types.KeyTypeHash},
+						{AttributeName: aws.String(cActivityRangeKey), KeyType: types.KeyTypeRange},
+					},
+					Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+					ProvisionedThroughput: &types.ProvisionedThroughput{
+						ReadCapacityUnits:  aws.Int64(cDefaultWRCapacity),
+						WriteCapacityUnits: aws.Int64(cDefaultWRCapacity),
+					},
+				},
+			},
+			ProvisionedThroughput: &types.ProvisionedThroughput{
+				ReadCapacityUnits:  aws.Int64(cDefaultWRCapacity),
+				WriteCapacityUnits: aws.Int64(cDefaultWRCapacity),
+			},
+		})
+		if err != nil {
+			log.Error("Error trying to create a table on Dynamo DB, table:", as.tableName, "Error:", err)
+			return err
+		}
+
+		if _, err = as.conn.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+			TableName: aws.String(as.tableName),
+			TimeToLiveSpecification: &types.TimeToLiveSpecification{
+				AttributeName: aws.String(cActivityTTLAttr),
+				Enabled:       aws.Bool(true),
+			},
+		}); err != nil {
+			log.Error("Error trying to enable TTL on table:", as.tableName, "Error:", err)
+			return err
+		}
+	}
+
+	return waitForActiveTable(ctx, as.conn, as.tableName)
+}
+
+func toActivityItem(entry ActivityEntry, retention time.Duration) activityItem {
+	ttl := entry.TTL
+	if ttl == 0 && retention > 0 {
+		ttl = time.Unix(entry.Ts, 0).Add(retention).Unix()
+	}
+
+	return activityItem{
+		UID:  entry.UID,
+		Ts:   entry.Ts,
+		Type: entry.Type,
+		Ip:   entry.Ip,
+		Desc: entry.Desc,
+		TTL:  ttl,
+	}
+}
+
+func fromActivityItem(item activityItem) ActivityEntry {
+	return ActivityEntry{
+		UID:  item.UID,
+		Ts:   item.Ts,
+		Type: item.Type,
+		Ip:   item.Ip,
+		Desc: item.Desc,
+		TTL:  item.TTL,
+	}
+}
+
+// decodeCursor/encodeCursor turn a DynamoDB LastEvaluatedKey into an opaque
+// string cursor callers can pass back on the next page request.
+func decodeCursor(cursor string) (map[string]types.AttributeValue, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var key map[string]interface{}
+	if err = json.Unmarshal(raw, &key); err != nil {
+		return nil, err
+	}
+
+	return attributevalue.MarshalMap(key)
+}
+
+func encodeCursor(key map[string]types.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+
+	var plain map[string]interface{}
+	if err := attributevalue.UnmarshalMap(key, &plain); err != nil {
+		return "", err
+	}
+
+	raw, err := json.Marshal(plain)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.URLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryActivityStore is a process-local ActivityStore used in tests;
+// pagination is emulated with an integer offset cursor.
+type MemoryActivityStore struct {
+	mutex     sync.Mutex
+	entries   []ActivityEntry
+	retention time.Duration
+}
+
+func NewMemoryActivityStore(retention time.Duration) *MemoryActivityStore {
+	return &MemoryActivityStore{retention: retention}
+}
+
+func (ms *MemoryActivityStore) Append(ctx context.Context, entry ActivityEntry) error {
+	return ms.AppendBatch(ctx, []ActivityEntry{entry})
+}
+
+func (ms *MemoryActivityStore) AppendBatch(ctx context.Context, entries []ActivityEntry) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	for _, entry := range entries {
+		if entry.TTL == 0 && ms.retention > 0 {
+			entry.TTL = time.Unix(entry.Ts, 0).Add(ms.retention).Unix()
+		}
+		ms.entries = append(ms.entries, entry)
+	}
+	sort.Slice(ms.entries, func(i, j int) bool { return ms.entries[i].Ts < ms.entries[j].Ts })
+
+	return nil
+}
+
+func (ms *MemoryActivityStore) Query(ctx context.Context, uid, typeFilter string, limit int32, cursor string) (entries []ActivityEntry, nextCursor string, err error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	offset, err := parseCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	matched := 0
+	for _, entry := range ms.entries {
+		if entry.UID != uid {
+			continue
+		}
+		if typeFilter != "" && entry.Type != typeFilter {
+			continue
+		}
+		if matched < offset {
+			matched++
+			continue
+		}
+
+		entries = append(entries, entry)
+		matched++
+		if limit > 0 && int32(len(entries)) == limit {
+			nextCursor = strconv.Itoa(matched)
+			break
+		}
+	}
+
+	return entries, nextCursor, nil
+}
+
+func (ms *MemoryActivityStore) QueryByType(ctx context.Context, activityType string, limit int32, cursor string) (entries []ActivityEntry, nextCursor string, err error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	offset, err := parseCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	matched := 0
+	for _, entry := range ms.entries {
+		if entry.Type != activityType {
+			continue
+		}
+		if matched < offset {
+			matched++
+			continue
+		}
+
+		entries = append(entries, entry)
+		matched++
+		if limit > 0 && int32(len(entries)) == limit {
+			nextCursor = strconv.Itoa(matched)
+			break
+		}
+	}
+
+	return entries, nextCursor, nil
+}
+
+func (ms *MemoryActivityStore) EnsureReady(ctx context.Context) error {
+	return nil
+}
+
+func parseCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(cursor)
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.etcd.io/bbolt"
+)
+
+var boltUsersBucket = []byte("users")
+
+// BoltStore is an embedded UserStore backed by a BoltDB file.
+type BoltStore struct {
+	db *bbolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := openBoltDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (bs *BoltStore) Put(ctx context.Context, uid string, item Item) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(boltUsersBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(uid), data)
+	})
+}
+
+func (bs *BoltStore) Get(ctx context.Context, uid string, consistent bool) (item Item, found bool, err error) {
+	err = bs.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltUsersBucket)
+		if bucket == nil {
+			return nil
+		}
+		data := bucket.Get([]byte(uid))
+		if data == nil {
+			return nil
+		}
+		found = true
+		item = Item{}
+		return json.Unmarshal(data, &item)
+	})
+	return item, found, err
+}
+
+func (bs *BoltStore) Scan(ctx context.Context) (items []Item, err error) {
+	err = bs.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltUsersBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			item := Item{}
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			items = append(items, item)
+			return nil
+		})
+	})
+	return items, err
+}
+
+func (bs *BoltStore) EnsureReady(ctx context.Context) error {
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltUsersBucket)
+		return err
+	})
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	boltDBsMutex sync.Mutex
+	boltDBs      = map[string]*bbolt.DB{}
+)
+
+// openBoltDB returns a shared *bbolt.DB for path, opening it only once per
+// process. bbolt takes an exclusive file lock per path with an indefinite
+// wait by default, so the users/activity/token Bolt stores must reuse one
+// handle instead of each calling bbolt.Open on the same file - the second
+// Open on an already-locked path would otherwise block forever.
+func openBoltDB(path string) (*bbolt.DB, error) {
+	boltDBsMutex.Lock()
+	defer boltDBsMutex.Unlock()
+
+	if db, ok := boltDBs[path]; ok {
+		return db, nil
+	}
+
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	boltDBs[path] = db
+	return db, nil
+}
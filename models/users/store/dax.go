@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/aws/aws-dax-go/dax"
+	awsv1 "github.com/aws/aws-sdk-go/aws"
+	dynamodbv1 "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// cDaxWrittenAtAttr carries the Unix write time alongside the item itself,
+// so freshness travels with the data and can be checked by any process
+// reading from DAX, not just the one that wrote it. It's stripped out of
+// every Item this package hands back to callers.
+const cDaxWrittenAtAttr = "_dax_written_at"
+
+// daxCache is a thin read-through cache in front of the users table, backed
+// by an AWS DAX cluster. The aws-dax-go client only speaks the classic (v1)
+// DynamoDB API, so this is the one place in the store package still wired
+// to aws-sdk-go v1 while the rest of it uses v2.
+type daxCache struct {
+	client    *dax.Dax
+	tableName string
+	ttl       time.Duration
+}
+
+func newDaxCache(endpoint, awsRegion, tableName string, ttl time.Duration) (*daxCache, error) {
+	cfg := dax.DefaultConfig()
+	cfg.HostPorts = []string{endpoint}
+	cfg.Region = awsRegion
+
+	client, err := dax.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &daxCache{client: client, tableName: tableName, ttl: ttl}, nil
+}
+
+func (dc *daxCache) get(ctx context.Context, uid string) (item Item, writtenAt time.Time, found bool, err error) {
+	key, err := dynamodbattribute.MarshalMap(map[string]string{cPrimKey: uid})
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	out, err := dc.client.GetItemWithContext(ctx, &dynamodbv1.GetItemInput{
+		TableName: awsv1.String(dc.tableName),
+		Key:       key,
+	})
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	if out.Item == nil {
+		return nil, time.Time{}, false, nil
+	}
+
+	item = Item{}
+	if err = dynamodbattribute.UnmarshalMap(out.Item, &item); err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	writtenAt = takeWrittenAt(item)
+	return item, writtenAt, true, nil
+}
+
+// refresh writes uid's item through the DAX client, stamped with the
+// current time, so its item cache picks up the new value and any reader
+// (on this process or another) can tell how fresh it is.
+func (dc *daxCache) refresh(ctx context.Context, uid string, item Item) error {
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return err
+	}
+	av[cPrimKey], err = dynamodbattribute.Marshal(uid)
+	if err != nil {
+		return err
+	}
+	av[cDaxWrittenAtAttr], err = dynamodbattribute.Marshal(strconv.FormatInt(time.Now().Unix(), 10))
+	if err != nil {
+		return err
+	}
+
+	_, err = dc.client.PutItemWithContext(ctx, &dynamodbv1.PutItemInput{
+		TableName: awsv1.String(dc.tableName),
+		Item:      av,
+	})
+	return err
+}
+
+func (dc *daxCache) tryGet(ctx context.Context, uid string) (item Item, found bool, ok bool) {
+	item, writtenAt, found, err := dc.get(ctx, uid)
+	if err != nil {
+		log.Error("Problem reading from DAX, falling back to DynamoDB, Error:", err)
+		return nil, false, false
+	}
+	if found && dc.stale(writtenAt) {
+		return nil, false, false
+	}
+	return item, found, true
+}
+
+// stale reports whether writtenAt is older than ttl, or missing entirely -
+// an item with no write-time attribute predates this cache generation (or
+// was written by something else) and can't be trusted as fresh.
+func (dc *daxCache) stale(writtenAt time.Time) bool {
+	if dc.ttl <= 0 {
+		return false
+	}
+	return writtenAt.IsZero() || time.Since(writtenAt) > dc.ttl
+}
+
+// scan reads the whole table through DAX, falling back to a direct
+// DynamoDB scan (ok=false) on any error or if any item's write-time attribute
+// is stale or missing - a partially-fresh scan would silently mix ages, so
+// the whole result is discarded rather than returned wrong.
+func (dc *daxCache) scan(ctx context.Context) (items []Item, ok bool) {
+	input := &dynamodbv1.ScanInput{TableName: awsv1.String(dc.tableName)}
+
+	for {
+		page, err := dc.client.ScanWithContext(ctx, input)
+		if err != nil {
+			log.Error("Problem scanning DAX, falling back to DynamoDB, Error:", err)
+			return nil, false
+		}
+
+		var pageItems []Item
+		if err = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageItems); err != nil {
+			log.Error("Problem scanning DAX, falling back to DynamoDB, Error:", err)
+			return nil, false
+		}
+		for _, pageItem := range pageItems {
+			if dc.stale(takeWrittenAt(pageItem)) {
+				return nil, false
+			}
+			items = append(items, pageItem)
+		}
+
+		if page.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = page.LastEvaluatedKey
+	}
+
+	return items, true
+}
+
+// takeWrittenAt pulls cDaxWrittenAtAttr out of item and removes it, so
+// callers outside this file never see the bookkeeping attribute.
+func takeWrittenAt(item Item) time.Time {
+	defer delete(item, cDaxWrittenAtAttr)
+
+	raw, _ := item[cDaxWrittenAtAttr].(string)
+	if raw == "" {
+		return time.Time{}
+	}
+
+	sec, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	cTable             = "users"
+	cPrimKey           = "uid"
+	cDefaultWRCapacity = 5
+)
+
+// DynamoDBStore is the production UserStore. Consistent reads always go
+// straight to DynamoDB; non-consistent reads can be routed through DAX.
+type DynamoDBStore struct {
+	tableName string
+	conn      *dynamodb.Client
+	cache     *daxCache
+}
+
+func NewDynamoDBStore(ctx context.Context, prefix, awsRegion, endpoint, daxEndpoint string, cacheTTL time.Duration) (*DynamoDBStore, error) {
+	awsCfg, err := loadAWSConfig(ctx, awsRegion, endpoint)
+	if err != nil {
+		log.Error("Problem trying to connect with DynamoDB, Error:", err)
+		return nil, err
+	}
+
+	tableName := fmt.Sprintf("%s_%s", prefix, cTable)
+	ds := &DynamoDBStore{
+		tableName: tableName,
+		conn:      dynamodb.NewFromConfig(awsCfg),
+	}
+
+	if daxEndpoint != "" {
+		if ds.cache, err = newDaxCache(daxEndpoint, awsRegion, tableName, cacheTTL); err != nil {
+			log.Error("Problem trying to connect with DAX, falling back to direct DynamoDB reads, Error:", err)
+			ds.cache = nil
+		}
+	}
+
+	return ds, nil
+}
+
+func (ds *DynamoDBStore) Put(ctx context.Context, uid string, item Item) error {
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return err
+	}
+	av[cPrimKey], err = attributevalue.Marshal(uid)
+	if err != nil {
+		return err
+	}
+
+	if _, err = ds.conn.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(ds.tableName),
+		Item:      av,
+	}); err != nil {
+		return err
+	}
+
+	if ds.cache != nil {
+		if err := ds.cache.refresh(ctx, uid, item); err != nil {
+			log.Error("Problem trying to refresh the DAX cache for user:", uid, "Error:", err)
+		}
+	}
+
+	return nil
+}
+
+func (ds *DynamoDBStore) Get(ctx context.Context, uid string, consistent bool) (item Item, found bool, err error) {
+	if !consistent && ds.cache != nil {
+		if cached, cacheFound, ok := ds.cache.tryGet(ctx, uid); ok {
+			return cached, cacheFound, nil
+		}
+	}
+
+	key, err := attributevalue.MarshalMap(map[string]string{cPrimKey: uid})
+	if err != nil {
+		return nil, false, err
+	}
+
+	out, err := ds.conn.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(ds.tableName),
+		Key:            key,
+		ConsistentRead: aws.Bool(consistent),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if out.Item == nil {
+		return nil, false, nil
+	}
+
+	item = Item{}
+	if err = attributevalue.UnmarshalMap(out.Item, &item); err != nil {
+		return nil, false, err
+	}
+	return item, true, nil
+}
+
+func (ds *DynamoDBStore) Scan(ctx context.Context) (items []Item, err error) {
+	if ds.cache != nil {
+		if cached, ok := ds.cache.scan(ctx); ok {
+			return cached, nil
+		}
+	}
+
+	paginator := dynamodb.NewScanPaginator(ds.conn, &dynamodb.ScanInput{
+		TableName: aws.String(ds.tableName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var pageItems []Item
+		if err = attributevalue.UnmarshalListOfMaps(page.Items, &pageItems); err != nil {
+			return nil, err
+		}
+		items = append(items, pageItems...)
+	}
+
+	return items, nil
+}
+
+func (ds *DynamoDBStore) EnsureReady(ctx context.Context) error {
+	_, err := ds.conn.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(ds.tableName),
+	})
+	if err != nil {
+		if !isTableNotFound(err) {
+			log.Error("Can't describe Dynamo DB instances table, Error:", err)
+			return err
+		}
+
+		log.Info("Creating a new table on DynamoDB:", ds.tableName)
+		_, err = ds.conn.CreateTable(ctx, &dynamodb.CreateTableInput{
+			TableName: aws.String(ds.tableName),
+			AttributeDefinitions: []types.AttributeDefinition{
+				{AttributeName: aws.String(cPrimKey), AttributeType: types.ScalarAttributeTypeS},
+			},
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String(cPrimKey), KeyType: types.KeyTypeHash},
+			},
+			ProvisionedThroughput: &types.ProvisionedThroughput{
+				ReadCapacityUnits:  aws.Int64(cDefaultWRCapacity),
+				WriteCapacityUnits: aws.Int64(cDefaultWRCapacity),
+			},
+		})
+		if err != nil {
+			log.Error("Error trying to create a table on Dynamo DB, table:", ds.tableName, "Error:", err)
+			return err
+		}
+	}
+
+	return waitForActiveTable(ctx, ds.conn, ds.tableName)
+}
+
+func loadAWSConfig(ctx context.Context, awsRegion, endpoint string) (aws.Config, error) {
+	optsFns := []func(*config.LoadOptions) error{
+		config.WithRegion(awsRegion),
+	}
+	if endpoint != "" {
+		optsFns = append(optsFns, config.WithEndpointResolverWithOptions(
+			aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+				return aws.Endpoint{URL: endpoint}, nil
+			}),
+		))
+	}
+
+	return config.LoadDefaultConfig(ctx, optsFns...)
+}
+
+func isTableNotFound(err error) bool {
+	var notFound *types.ResourceNotFoundException
+	return errors.As(err, &notFound)
+}
+
+func waitForActiveTable(ctx context.Context, conn *dynamodb.Client, tableName string) error {
+	for {
+		desc, err := conn.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(tableName),
+		})
+		if err != nil {
+			log.Error("Can't describe Dynamo DB instances table, Error:", err)
+			return err
+		}
+		if desc.Table.TableStatus == types.TableStatusActive {
+			return nil
+		}
+		log.Debug("Waiting for active table, current status:", desc.Table.TableStatus)
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore is a process-local UserStore backed by a plain map, used in tests.
+type MemoryStore struct {
+	mutex sync.Mutex
+	rows  map[string]Item
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{rows: make(map[string]Item)}
+}
+
+func (ms *MemoryStore) Put(ctx context.Context, uid string, item Item) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.rows[uid] = item
+	return nil
+}
+
+func (ms *MemoryStore) Get(ctx context.Context, uid string, consistent bool) (item Item, found bool, err error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	item, found = ms.rows[uid]
+	return item, found, nil
+}
+
+func (ms *MemoryStore) Scan(ctx context.Context) (items []Item, err error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	for _, item := range ms.rows {
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (ms *MemoryStore) EnsureReady(ctx context.Context) error {
+	return nil
+}
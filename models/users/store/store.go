@@ -0,0 +1,146 @@
+// Package store abstracts the persistence surface used by users.Model so it
+// isn't hard-wired to a single backend.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Item is the generic, backend agnostic representation of a user row.
+type Item map[string]interface{}
+
+// UserStore is the persistence surface required by users.Model. Get takes a
+// consistent flag so security-sensitive callers (e.g. password checks) can
+// bypass any caching layer a backend has in front of it.
+type UserStore interface {
+	Put(ctx context.Context, uid string, item Item) error
+	Get(ctx context.Context, uid string, consistent bool) (item Item, found bool, err error)
+	Scan(ctx context.Context) (items []Item, err error)
+	EnsureReady(ctx context.Context) error
+}
+
+// New builds a UserStore for backend "dynamodb", "bolt" or "memory".
+func New(ctx context.Context, backend string, cfg Config) (UserStore, error) {
+	switch backend {
+	case "dynamodb":
+		return NewDynamoDBStore(ctx, cfg.Prefix, cfg.AWSRegion, cfg.DynamoEndpoint, cfg.DaxEndpoint, cfg.DaxCacheTTL)
+	case "bolt":
+		return NewBoltStore(cfg.BoltPath)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("users/store: unknown backend %q", backend)
+	}
+}
+
+// ActivityEntry is a single activity-log row. TTL is a Unix timestamp after
+// which the backend may expire it.
+type ActivityEntry struct {
+	UID  string
+	Ts   int64
+	Type string
+	Ip   string
+	Desc string
+	TTL  int64
+}
+
+// ActivityStore is the persistence surface for user activity logs: append
+// only, queried by uid (optionally filtered by type) with pagination.
+type ActivityStore interface {
+	Append(ctx context.Context, entry ActivityEntry) error
+	AppendBatch(ctx context.Context, entries []ActivityEntry) error
+	Query(ctx context.Context, uid, typeFilter string, limit int32, cursor string) (entries []ActivityEntry, nextCursor string, err error)
+	// QueryByType lists a single type across every user, e.g. for admin
+	// dashboards.
+	QueryByType(ctx context.Context, activityType string, limit int32, cursor string) (entries []ActivityEntry, nextCursor string, err error)
+	EnsureReady(ctx context.Context) error
+}
+
+// NewActivityStore builds an ActivityStore for backend "dynamodb", "bolt" or
+// "memory".
+func NewActivityStore(ctx context.Context, backend string, cfg Config) (ActivityStore, error) {
+	switch backend {
+	case "dynamodb":
+		return NewDynamoDBActivityStore(ctx, cfg.Prefix, cfg.AWSRegion, cfg.DynamoEndpoint, cfg.ActivityRetention)
+	case "bolt":
+		return NewBoltActivityStore(cfg.BoltPath, cfg.ActivityRetention)
+	case "memory":
+		return NewMemoryActivityStore(cfg.ActivityRetention), nil
+	default:
+		return nil, fmt.Errorf("users/store: unknown backend %q", backend)
+	}
+}
+
+// TokenPurpose distinguishes what a token in the user_tokens table is for.
+type TokenPurpose string
+
+const (
+	TokenPurposeVerify       TokenPurpose = "verify"
+	TokenPurposeReset        TokenPurpose = "reset"
+	TokenPurposeMFAChallenge TokenPurpose = "mfa_challenge"
+)
+
+// Token is a single-use, short-lived token row keyed by the sha256 hash of
+// the value handed to the user - the raw value is never stored.
+type Token struct {
+	Hash     string
+	UID      string
+	Purpose  TokenPurpose
+	TTL      int64
+	Consumed bool
+}
+
+var (
+	ErrTokenNotFound = errors.New("users/store: token not found")
+	ErrTokenConsumed = errors.New("users/store: token already consumed")
+)
+
+// TokenStore is the persistence surface for verification/reset tokens. The
+// Consume/Put pair must be a single conditional write so a token can never
+// be redeemed twice, even under a race.
+type TokenStore interface {
+	Put(ctx context.Context, token Token) error
+	Get(ctx context.Context, hash string) (token Token, found bool, err error)
+	Consume(ctx context.Context, hash string) error
+	EnsureReady(ctx context.Context) error
+}
+
+// NewTokenStore builds a TokenStore for backend "dynamodb", "bolt" or
+// "memory".
+func NewTokenStore(ctx context.Context, backend string, cfg Config) (TokenStore, error) {
+	switch backend {
+	case "dynamodb":
+		return NewDynamoDBTokenStore(ctx, cfg.Prefix, cfg.AWSRegion, cfg.DynamoEndpoint)
+	case "bolt":
+		return NewBoltTokenStore(cfg.BoltPath)
+	case "memory":
+		return NewMemoryTokenStore(), nil
+	default:
+		return nil, fmt.Errorf("users/store: unknown backend %q", backend)
+	}
+}
+
+// Config carries the settings every backend might need. Only the fields
+// relevant to the selected backend are read.
+type Config struct {
+	Prefix string
+
+	// DynamoDB
+	AWSRegion      string
+	DynamoEndpoint string
+
+	// DaxEndpoint points the DynamoDB backend at a DAX cluster for
+	// read-through caching. Left empty, reads go straight to DynamoDB.
+	DaxEndpoint string
+	DaxCacheTTL time.Duration
+
+	// ActivityRetention is how long an activity-log entry is kept before
+	// it becomes eligible for expiry.
+	ActivityRetention time.Duration
+
+	// Bolt
+	BoltPath string
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.etcd.io/bbolt"
+)
+
+var boltTokensBucket = []byte("user_tokens")
+
+// BoltTokenStore is an embedded TokenStore backed by a BoltDB file. Bolt
+// transactions serialize every update, so a plain read-modify-write inside
+// Update gives Consume the same single-use guarantee DynamoDB gets from a
+// ConditionExpression.
+type BoltTokenStore struct {
+	db *bbolt.DB
+}
+
+func NewBoltTokenStore(path string) (*BoltTokenStore, error) {
+	db, err := openBoltDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltTokenStore{db: db}, nil
+}
+
+func (bs *BoltTokenStore) Put(ctx context.Context, token Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(boltTokensBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(token.Hash), data)
+	})
+}
+
+func (bs *BoltTokenStore) Get(ctx context.Context, hash string) (token Token, found bool, err error) {
+	err = bs.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltTokensBucket)
+		if bucket == nil {
+			return nil
+		}
+		data := bucket.Get([]byte(hash))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &token)
+	})
+	return token, found, err
+}
+
+func (bs *BoltTokenStore) Consume(ctx context.Context, hash string) error {
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(boltTokensBucket)
+		if err != nil {
+			return err
+		}
+
+		data := bucket.Get([]byte(hash))
+		if data == nil {
+			return ErrTokenNotFound
+		}
+
+		var token Token
+		if err := json.Unmarshal(data, &token); err != nil {
+			return err
+		}
+		if token.Consumed {
+			return ErrTokenConsumed
+		}
+
+		token.Consumed = true
+		newData, err := json.Marshal(token)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(hash), newData)
+	})
+}
+
+func (bs *BoltTokenStore) EnsureReady(ctx context.Context) error {
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltTokensBucket)
+		return err
+	})
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	cTokenTable   = "user_tokens"
+	cTokenHashKey = "hash"
+	cTokenTTLAttr = "ttl"
+)
+
+type tokenItem struct {
+	Hash     string `dynamodbav:"hash"`
+	UID      string `dynamodbav:"uid"`
+	Purpose  string `dynamodbav:"purpose"`
+	TTL      int64  `dynamodbav:"ttl"`
+	Consumed bool   `dynamodbav:"consumed,omitempty"`
+}
+
+// DynamoDBTokenStore is the production TokenStore, keyed by the token hash.
+type DynamoDBTokenStore struct {
+	tableName string
+	conn      *dynamodb.Client
+}
+
+func NewDynamoDBTokenStore(ctx context.Context, prefix, awsRegion, endpoint string) (*DynamoDBTokenStore, error) {
+	awsCfg, err := loadAWSConfig(ctx, awsRegion, endpoint)
+	if err != nil {
+		log.Error("Problem trying to connect with DynamoDB, Error:", err)
+		return nil, err
+	}
+
+	return &DynamoDBTokenStore{
+		tableName: fmt.Sprintf("%s_%s", prefix, cTokenTable),
+		conn:      dynamodb.NewFromConfig(awsCfg),
+	}, nil
+}
+
+func (ts *DynamoDBTokenStore) Put(ctx context.Context, token Token) error {
+	item, err := attributevalue.MarshalMap(tokenItem{
+		Hash:    token.Hash,
+		UID:     token.UID,
+		Purpose: string(token.Purpose),
+		TTL:     token.TTL,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = ts.conn.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(ts.tableName),
+		Item:      item,
+	})
+	return err
+}
+
+func (ts *DynamoDBTokenStore) Get(ctx context.Context, hash string) (token Token, found bool, err error) {
+	key, err := attributevalue.MarshalMap(map[string]string{cTokenHashKey: hash})
+	if err != nil {
+		return Token{}, false, err
+	}
+
+	out, err := ts.conn.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(ts.tableName),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return Token{}, false, err
+	}
+	if out.Item == nil {
+		return Token{}, false, nil
+	}
+
+	var item tokenItem
+	if err = attributevalue.UnmarshalMap(out.Item, &item); err != nil {
+		return Token{}, false, err
+	}
+
+	return Token{
+		Hash:     item.Hash,
+		UID:      item.UID,
+		Purpose:  TokenPurpose(item.Purpose),
+		TTL:      item.TTL,
+		Consumed: item.Consumed,
+	}, true, nil
+}
+
+// Consume sets consumed=true with ConditionExpression
+// attribute_not_exists(consumed), so two concurrent redemptions of the same
+// token can't both succeed.
+func (ts *DynamoDBTokenStore) Consume(ctx context.Context, hash string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{cTokenHashKey: hash})
+	if err != nil {
+		return err
+	}
+
+	_, err = ts.conn.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(ts.tableName),
+		Key:                 key,
+		UpdateExpression:    aws.String("SET consumed = :true"),
+		ConditionExpression: aws.String("attribute_exists(#hash) AND attribute_not_exists(consumed)"),
+		ExpressionAttributeNames: map[string]string{
+			"#hash": cTokenHashKey,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":true": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	})
+	if err == nil {
+		return nil
+	}
+
+	var condFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &condFailed) {
+		if _, found, getErr := ts.Get(ctx, hash); getErr == nil && found {
+			return ErrTokenConsumed
+		}
+		return ErrTokenNotFound
+	}
+
+	return err
+}
+
+func (ts *DynamoDBTokenStore) EnsureReady(ctx context.Context) error {
+	_, err := ts.conn.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(ts.tableName),
+	})
+	if err != nil {
+		if !isTableNotFound(err) {
+			log.Error("Can't describe Dynamo DB instances table, Error:", err)
+			return err
+		}
+
+		log.Info("Creating a new table on DynamoDB:", ts.tableName)
+		_, err = ts.conn.CreateTable(ctx, &dynamodb.CreateTableInput{
+			TableName: aws.String(ts.tableName),
+			AttributeDefinitions: []types.AttributeDefinition{
+				{AttributeName: aws.String(cTokenHashKey), AttributeType: types.ScalarAttributeTypeS},
+			},
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String(cTokenHashKey), KeyType: types.KeyTypeHash},
+			},
+			ProvisionedThroughput: &types.ProvisionedThroughput{
+				ReadCapacityUnits:  aws.Int64(cDefaultWRCapacity),
+				WriteCapacityUnits: aws.Int64(cDefaultWRCapacity),
+			},
+		})
+		if err != nil {
+			log.Error("Error trying to create a table on Dynamo DB, table:", ts.tableName, "Error:", err)
+			return err
+		}
+
+		if _, err = ts.conn.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+			TableName: aws.String(ts.tableName),
+			TimeToLiveSpecification: &types.TimeToLiveSpecification{
+				AttributeName: aws.String(cTokenTTLAttr),
+				Enabled:       aws.Bool(true),
+			},
+		}); err != nil {
+			log.Error("Error trying to enable TTL on table:", ts.tableName, "Error:", err)
+			return err
+		}
+	}
+
+	return waitForActiveTable(ctx, ts.conn, ts.tableName)
+}
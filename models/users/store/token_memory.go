@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryTokenStore is a process-local TokenStore used in unit tests.
+type MemoryTokenStore struct {
+	mutex  sync.Mutex
+	tokens map[string]Token
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]Token)}
+}
+
+func (ms *MemoryTokenStore) Put(ctx context.Context, token Token) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.tokens[token.Hash] = token
+	return nil
+}
+
+func (ms *MemoryTokenStore) Get(ctx context.Context, hash string) (token Token, found bool, err error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	token, found = ms.tokens[hash]
+	return token, found, nil
+}
+
+func (ms *MemoryTokenStore) Consume(ctx context.Context, hash string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	token, found := ms.tokens[hash]
+	if !found {
+		return ErrTokenNotFound
+	}
+	if token.Consumed {
+		return ErrTokenConsumed
+	}
+
+	token.Consumed = true
+	ms.tokens[hash] = token
+	return nil
+}
+
+func (ms *MemoryTokenStore) EnsureReady(ctx context.Context) error {
+	return nil
+}
@@ -1,45 +1,64 @@
 package users
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/alonsovidales/pit/log"
-	"github.com/goamz/goamz/aws"
-	"github.com/goamz/goamz/dynamodb"
+	"github.com/alonsovidales/pit/models/users/store"
 	"golang.org/x/crypto/pbkdf2"
-	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
 const (
-	cTable             = "users"
-	cPrimKey           = "uid"
-	cDefaultWRCapacity = 5
-
 	CActivityAccountType = "account"
 	CActivityShardsType  = "shards"
+
+	// cLegacyLogsAttr is the "logs" attribute older user rows may still
+	// carry from before activity moved to its own store.ActivityStore.
+	cLegacyLogsAttr = "logs"
+
+	cTokenBytes     = 32
+	cVerifyTokenTTL = 48 * time.Hour
+	cResetTokenTTL  = time.Hour
 )
 
+// ErrInvalidToken is returned by ConfirmVerification/ResetPassword when the
+// token doesn't exist, is for the wrong purpose, has expired, or was
+// already used once.
+var ErrInvalidToken = errors.New("users: invalid or expired token")
+
 type ModelInt interface {
-	RegisterUserPlainKey(uid string, key string, ip string) (*User, error)
+	RegisterUserPlainKey(ctx context.Context, uid string, key string, ip string) (*User, error)
 	HashPassword(password string) string
-	RegisterUser(uid string, key string, ip string) (user *User, err error)
-	GetUserInfo(uid string, key string) (user *User)
-	AdminGetUserInfoByID(uid string) (user *User)
-	GetRegisteredUsers() (users map[string]*User)
+	RegisterUser(ctx context.Context, uid string, key string, ip string) (user *User, err error)
+	GetUserInfo(ctx context.Context, uid string, key string) (user *User, challenge string)
+	VerifyMFA(ctx context.Context, uid, challenge, code string) (user *User)
+	VerifyRecoveryCode(ctx context.Context, uid, challenge, code string) (user *User)
+	AdminGetUserInfoByID(ctx context.Context, uid string) (user *User)
+	GetRegisteredUsers(ctx context.Context) (users map[string]*User)
+	IssueVerificationToken(ctx context.Context, uid string) (token string, err error)
+	ConfirmVerification(ctx context.Context, token string) error
+	IssueResetToken(ctx context.Context, uid string) (token string, err error)
+	ResetPassword(ctx context.Context, token, newKey string) error
 }
 
 type UsersInt interface {
-	DisableUser() (persisted bool)
-	EnableUser() (persisted bool)
-	UpdateUser(key string) bool
-	AddActivityLog(actionType string, des string, ip string) bool
-	GetAllActivity() (activity map[string]*LogLine)
+	DisableUser(ctx context.Context) (persisted bool)
+	EnableUser(ctx context.Context) (persisted bool)
+	UpdateUser(ctx context.Context, key string) bool
+	AddActivityLog(ctx context.Context, actionType string, des string, ip string) bool
+	GetAllActivity(ctx context.Context, typeFilter string, limit int32, cursor string) (activity []*LogLine, nextCursor string, err error)
+	EnrollTOTP(ctx context.Context) (secret string, otpauthURL string, err error)
+	ConfirmTOTP(ctx context.Context, code string) (recoveryCodes []string, err error)
+	DisableTOTP(ctx context.Context, code string) error
 }
 
 type LogLine struct {
@@ -52,11 +71,16 @@ type LogLine struct {
 type Model struct {
 	ModelInt
 
-	prefix    string
-	secret    []byte
-	tableName string
-	conn      *dynamodb.Server
-	table     *dynamodb.Table
+	prefix   string
+	secret   []byte
+	store    store.UserStore
+	activity store.ActivityStore
+	tokens   store.TokenStore
+	mailer   Mailer
+
+	// requireVerification, when set, makes GetUserInfo refuse to log in a
+	// user whose Verified flag hasn't been set via ConfirmVerification.
+	requireVerification bool
 }
 
 type User struct {
@@ -65,40 +89,77 @@ type User struct {
 	uid     string
 	key     string
 	Enabled string `json:"-"`
-	logs    map[string][]*LogLine
 
-	RegTs int64  `json:"reg_ts"`
-	RegIp string `json:"reg_ip"`
+	// legacyLogs holds activity read from the now-retired "logs" row
+	// attribute, until it's migrated into md.activity on first touch.
+	legacyLogs map[string][]*LogLine
+
+	RegTs    int64  `json:"reg_ts"`
+	RegIp    string `json:"reg_ip"`
+	Verified bool   `json:"verified"`
+
+	// mfaSecretEnc is the AES-GCM sealed TOTP secret; see mfa.go.
+	mfaSecretEnc      string
+	mfaEnabled        bool
+	mfaUsedWindows    []int64
+	mfaRecoveryHashes []string
 
 	mutex sync.Mutex
 	md    *Model
 }
 
-func GetModel(prefix string, awsRegion string) (um *Model) {
-	if awsAuth, err := aws.EnvAuth(); err == nil {
-		um = &Model{
-			prefix:    prefix,
-			tableName: fmt.Sprintf("%s_%s", prefix, cTable),
-			secret:    []byte(os.Getenv("PIT_SECRET")),
-			conn: &dynamodb.Server{
-				Auth:   awsAuth,
-				Region: aws.Regions[awsRegion],
-			},
-		}
-		um.initTable()
-	} else {
-		log.Error("Problem trying to connect with DynamoDB, Error:", err)
+// Deps are the dependencies GetModel needs to build a Model. Grouping them
+// in a struct keeps the constructor readable as the model grows new backing
+// stores; zero-value Mailer/RequireVerification are valid (no mail sent, no
+// verification required).
+type Deps struct {
+	Secret              []byte
+	Store               store.UserStore
+	Activity            store.ActivityStore
+	Tokens              store.TokenStore
+	Mailer              Mailer
+	RequireVerification bool
+}
+
+// GetModel returns a Model that persists users, their activity and their
+// verification/reset tokens through the given stores. Callers pick the
+// concrete backends (DynamoDB, Bolt, an in-memory store for tests, ...) via
+// store.New/store.NewActivityStore/store.NewTokenStore and pass them in
+// here, so Model itself never knows which storage engine is behind it.
+func GetModel(ctx context.Context, prefix string, deps Deps) (um *Model, err error) {
+	mailer := deps.Mailer
+	if mailer == nil {
+		mailer = NoopMailer{}
+	}
+
+	um = &Model{
+		prefix:              prefix,
+		secret:              deps.Secret,
+		store:               deps.Store,
+		activity:            deps.Activity,
+		tokens:              deps.Tokens,
+		mailer:              mailer,
+		requireVerification: deps.RequireVerification,
+	}
+	if err = um.store.EnsureReady(ctx); err != nil {
+		return nil, err
+	}
+	if err = um.activity.EnsureReady(ctx); err != nil {
+		return nil, err
+	}
+	if err = um.tokens.EnsureReady(ctx); err != nil {
+		return nil, err
 	}
 
-	return
+	return um, nil
 }
 
-func (um *Model) RegisterUserPlainKey(uid string, key string, ip string) (*User, error) {
+func (um *Model) RegisterUserPlainKey(ctx context.Context, uid string, key string, ip string) (*User, error) {
 	// Sanitize e-mail addr removin all the + Chars in order to avoid fake
 	// duplicated accounts
 	uid = strings.Replace(uid, "+", "", -1)
 
-	if um.AdminGetUserInfoByID(uid) != nil {
+	if um.AdminGetUserInfoByID(ctx, uid) != nil {
 		return nil, errors.New("Existing user account")
 	}
 
@@ -106,7 +167,6 @@ func (um *Model) RegisterUserPlainKey(uid string, key string, ip string) (*User,
 		uid:     uid,
 		key:     key,
 		Enabled: "1",
-		logs:    make(map[string][]*LogLine),
 
 		RegTs: time.Now().Unix(),
 		RegIp: ip,
@@ -114,183 +174,375 @@ func (um *Model) RegisterUserPlainKey(uid string, key string, ip string) (*User,
 		md: um,
 	}
 
-	if !user.persist() {
+	if !user.persist(ctx) {
 		return nil, errors.New("Error trying to store the user data")
 	}
 	return user, nil
 }
 
-func (um *Model) RegisterUser(uid string, key string, ip string) (*User, error) {
-	return um.RegisterUserPlainKey(uid, um.HashPassword(key), ip)
+func (um *Model) RegisterUser(ctx context.Context, uid string, key string, ip string) (*User, error) {
+	return um.RegisterUserPlainKey(ctx, uid, um.HashPassword(key), ip)
 }
 
-func (um *Model) GetUserInfo(uid string, key string) (user *User) {
-	user = um.AdminGetUserInfoByID(uid)
+// GetUserInfo verifies a login. Password verification is security
+// sensitive, so it always reads through a strongly-consistent fetch and
+// bypasses any caching layer the store has in front of it. When the model
+// requires verification, an unverified user is treated as a failed login.
+//
+// If the user has TOTP enabled, the password alone isn't enough: GetUserInfo
+// returns a nil user together with a short-lived challenge, and the caller
+// must complete the login with VerifyMFA or VerifyRecoveryCode.
+func (um *Model) GetUserInfo(ctx context.Context, uid string, key string) (user *User, challenge string) {
+	user = um.getUserByID(ctx, uid, true)
 	if user == nil || user.key != um.HashPassword(key) || user.Enabled == "0" {
+		return nil, ""
+	}
+	if um.requireVerification && !user.Verified {
+		return nil, ""
+	}
+
+	if user.mfaEnabled {
+		challenge, err := um.issueMFAChallenge(ctx, uid)
+		if err != nil {
+			log.Error("Problem trying to issue an MFA challenge for user:", uid, "Error:", err)
+			return nil, ""
+		}
+		return nil, challenge
+	}
+
+	return user, ""
+}
+
+// AdminGetUserInfoByID is the admin/lookup path. It's the hottest read in
+// the model, so it's allowed to come from a cache (e.g. DAX) when the store
+// has one configured.
+func (um *Model) AdminGetUserInfoByID(ctx context.Context, uid string) (user *User) {
+	return um.getUserByID(ctx, uid, false)
+}
+
+func (um *Model) getUserByID(ctx context.Context, uid string, consistent bool) (user *User) {
+	item, found, err := um.store.Get(ctx, uid, consistent)
+	if err != nil {
+		log.Error("Problem trying to retieve the user information for user:", uid, "Error:", err)
+		return nil
+	}
+	if !found {
 		return nil
 	}
 
-	return
+	user, err = userFromItem(uid, item, um)
+	if err != nil {
+		log.Error("Problem trying to retieve the user information for user:", uid, "Error:", err)
+		return nil
+	}
+
+	return user
 }
 
-func (um *Model) AdminGetUserInfoByID(uid string) (user *User) {
-	attKey := &dynamodb.Key{
-		HashKey:  uid,
-		RangeKey: "",
-	}
-	if data, err := um.table.GetItemConsistent(attKey, true); err == nil {
-		user = &User{
-			uid:     uid,
-			key:     data["key"].Value,
-			Enabled: data["enabled"].Value,
-			logs:    make(map[string][]*LogLine),
-			md:      um,
-		}
-		if err := json.Unmarshal([]byte(data["info"].Value), &user); err != nil {
+func (um *Model) GetRegisteredUsers(ctx context.Context) (users map[string]*User) {
+	rows, err := um.store.Scan(ctx)
+	if err != nil {
+		log.Error("Problem trying to scan the users store, Error:", err)
+		return nil
+	}
+
+	users = make(map[string]*User)
+	for _, row := range rows {
+		uid, _ := row["uid"].(string)
+		user, err := userFromItem(uid, row, um)
+		if err != nil {
 			log.Error("Problem trying to retieve the user information for user:", uid, "Error:", err)
 			return nil
 		}
-		if err = json.Unmarshal([]byte(data["logs"].Value), &user.logs); err != nil {
-			log.Error("Problem trying to unmarshal the user logs for user:", uid, "Error:", err)
-			return nil
-		}
+		users[uid] = user
+	}
+
+	return users
+}
+
+// IssueVerificationToken generates a single-use e-mail verification token
+// for uid, stores its hash, and e-mails the raw value through um.mailer.
+func (um *Model) IssueVerificationToken(ctx context.Context, uid string) (token string, err error) {
+	return um.issueToken(ctx, uid, store.TokenPurposeVerify, cVerifyTokenTTL, um.mailer.SendVerificationEmail)
+}
+
+// ConfirmVerification redeems a verification token and marks its owner as
+// Verified.
+func (um *Model) ConfirmVerification(ctx context.Context, token string) error {
+	uid, err := um.consumeToken(ctx, token, store.TokenPurposeVerify)
+	if err != nil {
+		return err
+	}
+
+	user := um.AdminGetUserInfoByID(ctx, uid)
+	if user == nil {
+		return ErrInvalidToken
+	}
+
+	user.Verified = true
+	if !user.persist(ctx) {
+		return errors.New("Error trying to store the user data")
+	}
+
+	return nil
+}
+
+// IssueResetToken generates a single-use password-reset token for uid,
+// stores its hash, and e-mails the raw value through um.mailer.
+func (um *Model) IssueResetToken(ctx context.Context, uid string) (token string, err error) {
+	return um.issueToken(ctx, uid, store.TokenPurposeReset, cResetTokenTTL, um.mailer.SendPasswordResetEmail)
+}
+
+// ResetPassword redeems a password-reset token and sets its owner's
+// password to newKey.
+func (um *Model) ResetPassword(ctx context.Context, token, newKey string) error {
+	uid, err := um.consumeToken(ctx, token, store.TokenPurposeReset)
+	if err != nil {
+		return err
+	}
+
+	user := um.AdminGetUserInfoByID(ctx, uid)
+	if user == nil {
+		return ErrInvalidToken
+	}
+
+	if !user.UpdateUser(ctx, newKey) {
+		return errors.New("Error trying to store the user data")
+	}
+
+	return nil
+}
+
+func (um *Model) issueToken(ctx context.Context, uid string, purpose store.TokenPurpose, ttl time.Duration, send func(ctx context.Context, uid, token string) error) (token string, err error) {
+	raw := make([]byte, cTokenBytes)
+	if _, err = rand.Read(raw); err != nil {
+		return "", err
+	}
+	token = hex.EncodeToString(raw)
+
+	if err = um.tokens.Put(ctx, store.Token{
+		Hash:    hashToken(token),
+		UID:     uid,
+		Purpose: purpose,
+		TTL:     time.Now().Add(ttl).Unix(),
+	}); err != nil {
+		log.Error("Problem trying to store the token for user:", uid, "Error:", err)
+		return "", err
 	}
 
-	return
+	if err = send(ctx, uid, token); err != nil {
+		log.Error("Problem trying to send the token e-mail for user:", uid, "Error:", err)
+		return "", err
+	}
+
+	return token, nil
 }
 
-func (um *Model) GetRegisteredUsers() (users map[string]*User) {
-	if rows, err := um.table.Scan(nil); err == nil {
-		users = make(map[string]*User)
-		for _, row := range rows {
-			uid := row["uid"].Value
-			user := &User{
-				uid:     uid,
-				key:     row["key"].Value,
-				Enabled: row["enabled"].Value,
-				logs:    make(map[string][]*LogLine),
-				md:      um,
-			}
-			if err := json.Unmarshal([]byte(row["info"].Value), &user); err != nil {
-				log.Error("Problem trying to retieve the user information for user:", user.uid, "Error:", err)
-				return nil
-			}
-			if err = json.Unmarshal([]byte(row["logs"].Value), &user.logs); err != nil {
-				log.Error("Problem trying to unmarshal the user logs for user:", user.uid, "Error:", err)
-				return nil
-			}
-			users[uid] = user
+func (um *Model) consumeToken(ctx context.Context, token string, purpose store.TokenPurpose) (uid string, err error) {
+	hash := hashToken(token)
+
+	t, found, err := um.tokens.Get(ctx, hash)
+	if err != nil {
+		log.Error("Problem trying to retrieve a token, Error:", err)
+		return "", err
+	}
+	if !found || t.Purpose != purpose || time.Now().Unix() > t.TTL {
+		return "", ErrInvalidToken
+	}
+
+	if err = um.tokens.Consume(ctx, hash); err != nil {
+		if errors.Is(err, store.ErrTokenConsumed) || errors.Is(err, store.ErrTokenNotFound) {
+			return "", ErrInvalidToken
 		}
+		log.Error("Problem trying to consume a token, Error:", err)
+		return "", err
 	}
 
-	return
+	return t.UID, nil
 }
 
-func (us *User) DisableUser() (persisted bool) {
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (us *User) DisableUser(ctx context.Context) (persisted bool) {
 	us.Enabled = "0"
 
-	return us.persist()
+	return us.persist(ctx)
 }
 
-func (us *User) EnableUser() (persisted bool) {
+func (us *User) EnableUser(ctx context.Context) (persisted bool) {
 	us.Enabled = "1"
 
-	return us.persist()
+	return us.persist(ctx)
 }
 
-func (us *User) UpdateUser(key string) bool {
+func (us *User) UpdateUser(ctx context.Context, key string) bool {
 	us.key = us.md.HashPassword(key)
 
-	return us.persist()
+	return us.persist(ctx)
 }
 
-func (us *User) AddActivityLog(actionType string, desc, ip string) bool {
-	if _, ok := us.logs[actionType]; !ok {
-		us.logs[actionType] = []*LogLine{}
+// AddActivityLog appends a single entry to the activity store. It used to
+// rewrite the whole user row on every call; now it's one PutItem against
+// the dedicated, TTL-expiring activity table.
+func (us *User) AddActivityLog(ctx context.Context, actionType string, desc, ip string) bool {
+	us.migrateLegacyLogs(ctx)
+
+	if err := us.md.activity.Append(ctx, store.ActivityEntry{
+		UID:  us.uid,
+		Ts:   time.Now().Unix(),
+		Type: actionType,
+		Ip:   ip,
+		Desc: desc,
+	}); err != nil {
+		log.Error("Problem trying to store the activity log for user:", us.uid, "Error:", err)
+		return false
 	}
 
-	us.logs[actionType] = append(us.logs[actionType], &LogLine{
-		Ip:      ip,
-		Ts:      time.Now().Unix(),
-		LogType: actionType,
-		Desc:    desc,
-	})
-
-	return us.persist()
+	return true
 }
 
-func (us *User) GetAllActivity() (activity map[string][]*LogLine) {
-	return us.logs
-}
+// GetAllActivity queries the user's activity, optionally filtered by type,
+// paginated via an opaque cursor returned alongside the page of entries.
+func (us *User) GetAllActivity(ctx context.Context, typeFilter string, limit int32, cursor string) (activity []*LogLine, nextCursor string, err error) {
+	us.migrateLegacyLogs(ctx)
 
-func (um *Model) HashPassword(password string) string {
-	return base64.StdEncoding.EncodeToString(pbkdf2.Key([]byte(password), um.secret, 4096, sha256.Size, sha256.New))
+	entries, nextCursor, err := us.md.activity.Query(ctx, us.uid, typeFilter, limit, cursor)
+	if err != nil {
+		log.Error("Problem trying to retrieve the activity log for user:", us.uid, "Error:", err)
+		return nil, "", err
+	}
+
+	for _, entry := range entries {
+		activity = append(activity, &LogLine{
+			Ts:      entry.Ts,
+			Ip:      entry.Ip,
+			LogType: entry.Type,
+			Desc:    entry.Desc,
+		})
+	}
+
+	return activity, nextCursor, nil
 }
 
-func (um *Model) delTable() {
-	if tableDesc, err := um.conn.DescribeTable(um.tableName); err == nil {
-		if _, err = um.conn.DeleteTable(*tableDesc); err != nil {
-			log.Error("Can't remove Dynamo table:", um.tableName, "Error:", err)
+// migrateLegacyLogs is the one-time upgrade path for rows written before
+// activity had its own table: it batch-writes whatever is left in the
+// legacy "logs" blob into md.activity, then re-persists the user row so the
+// next PutItem drops the attribute for good. handled reports whether a
+// migration ran at all; when it did, persisted carries the real result of
+// that re-persist so persist() doesn't have to guess.
+func (us *User) migrateLegacyLogs(ctx context.Context) (handled bool, persisted bool) {
+	if len(us.legacyLogs) == 0 {
+		return false, false
+	}
+
+	var entries []store.ActivityEntry
+	for actionType, lines := range us.legacyLogs {
+		for _, line := range lines {
+			entries = append(entries, store.ActivityEntry{
+				UID:  us.uid,
+				Ts:   line.Ts,
+				Type: actionType,
+				Ip:   line.Ip,
+				Desc: line.Desc,
+			})
 		}
-	} else {
-		log.Error("Can't remove Dynamo table:", um.tableName, "Error:", err)
 	}
+
+	if err := us.md.activity.AppendBatch(ctx, entries); err != nil {
+		log.Error("Problem trying to migrate the legacy activity log for user:", us.uid, "Error:", err)
+		return false, false
+	}
+
+	us.legacyLogs = nil
+	return true, us.persist(ctx)
 }
 
-func (us *User) persist() bool {
-	userJsonInfo, _ := json.Marshal(us)
-	userJsonLogs, _ := json.Marshal(us.logs)
+func (um *Model) HashPassword(password string) string {
+	return base64.StdEncoding.EncodeToString(pbkdf2.Key([]byte(password), um.secret, 4096, sha256.Size, sha256.New))
+}
 
-	attribs := []dynamodb.Attribute{
-		*dynamodb.NewStringAttribute(cPrimKey, us.uid),
-		*dynamodb.NewStringAttribute("key", us.key),
-		*dynamodb.NewStringAttribute("info", string(userJsonInfo)),
-		*dynamodb.NewStringAttribute("logs", string(userJsonLogs)),
-		*dynamodb.NewStringAttribute("enabled", string(us.Enabled)),
+// persist writes the user row. Every write path goes through here, so this
+// is also where a legacy "logs" blob gets migrated on first touch -
+// migrateLegacyLogs re-enters persist once the migration itself is done, so
+// we skip writing the row a second time here.
+func (us *User) persist(ctx context.Context) bool {
+	if handled, persisted := us.migrateLegacyLogs(ctx); handled {
+		return persisted
 	}
 
-	if _, err := us.md.table.PutItem(us.uid, cPrimKey, attribs); err != nil {
+	if err := us.md.store.Put(ctx, us.uid, toItem(us)); err != nil {
 		log.Error("A new user can't be registered on the users table, Error:", err)
-
 		return false
 	}
 
 	return true
 }
 
-func (um *Model) initTable() {
-	pKey := dynamodb.PrimaryKey{dynamodb.NewStringAttribute(cPrimKey, ""), nil}
-	um.table = um.conn.NewTable(um.tableName, pKey)
+// toItem converts a User into the backend agnostic row stored by a
+// store.UserStore. Every value is kept as a string so that DynamoDB, Bolt
+// and the in-memory store round-trip it identically. Activity no longer
+// lives here, so the legacy "logs" attribute is simply omitted.
+func toItem(us *User) store.Item {
+	item := store.Item{
+		"uid":      us.uid,
+		"key":      us.key,
+		"enabled":  us.Enabled,
+		"reg_ts":   strconv.FormatInt(us.RegTs, 10),
+		"reg_ip":   us.RegIp,
+		"verified": strconv.FormatBool(us.Verified),
+	}
 
-	res, err := um.table.DescribeTable()
-	if err != nil {
-		log.Info("Creating a new table on DynamoDB:", um.tableName)
-		td := dynamodb.TableDescriptionT{
-			TableName: um.tableName,
-			AttributeDefinitions: []dynamodb.AttributeDefinitionT{
-				dynamodb.AttributeDefinitionT{cPrimKey, "S"},
-			},
-			KeySchema: []dynamodb.KeySchemaT{
-				dynamodb.KeySchemaT{cPrimKey, "HASH"},
-			},
-			ProvisionedThroughput: dynamodb.ProvisionedThroughputT{
-				ReadCapacityUnits:  cDefaultWRCapacity,
-				WriteCapacityUnits: cDefaultWRCapacity,
-			},
+	if us.mfaSecretEnc != "" {
+		item["mfa_secret"] = us.mfaSecretEnc
+		item["mfa_enabled"] = strconv.FormatBool(us.mfaEnabled)
+		if windows := marshalUsedWindows(us.mfaUsedWindows); windows != "" {
+			item["mfa_used_windows"] = windows
 		}
-
-		if _, err := um.conn.CreateTable(td); err != nil {
-			log.Error("Error trying to create a table on Dynamo DB, table:", um.tableName, "Error:", err)
+		if codes := marshalRecoveryHashes(us.mfaRecoveryHashes); codes != "" {
+			item["mfa_recovery_codes"] = codes
 		}
-		if res, err = um.table.DescribeTable(); err != nil {
-			log.Error("Error trying to describe a table on Dynamo DB, table:", um.tableName, "Error:", err)
+	}
+
+	return item
+}
+
+func userFromItem(uid string, item store.Item, md *Model) (*User, error) {
+	user := &User{
+		uid:      uid,
+		Enabled:  stringField(item, "enabled"),
+		key:      stringField(item, "key"),
+		RegIp:    stringField(item, "reg_ip"),
+		Verified: stringField(item, "verified") == "true",
+
+		mfaSecretEnc:      stringField(item, "mfa_secret"),
+		mfaEnabled:        stringField(item, "mfa_enabled") == "true",
+		mfaUsedWindows:    unmarshalUsedWindows(stringField(item, "mfa_used_windows")),
+		mfaRecoveryHashes: unmarshalRecoveryHashes(stringField(item, "mfa_recovery_codes")),
+
+		md: md,
+	}
+
+	if regTs := stringField(item, "reg_ts"); regTs != "" {
+		ts, err := strconv.ParseInt(regTs, 10, 64)
+		if err != nil {
+			return nil, err
 		}
+		user.RegTs = ts
 	}
-	for "ACTIVE" != res.TableStatus {
-		if res, err = um.table.DescribeTable(); err != nil {
-			log.Error("Can't describe Dynamo DB instances table, Error:", err)
+
+	if legacyLogs := stringField(item, cLegacyLogsAttr); legacyLogs != "" {
+		if err := json.Unmarshal([]byte(legacyLogs), &user.legacyLogs); err != nil {
+			return nil, err
 		}
-		log.Debug("Waiting for active table, current status:", res.TableStatus)
-		time.Sleep(time.Second)
 	}
+
+	return user, nil
+}
+
+func stringField(item store.Item, field string) string {
+	v, _ := item[field].(string)
+	return v
 }
@@ -0,0 +1,213 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alonsovidales/pit/models/users/store"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+)
+
+func newTestModel(t *testing.T) *Model {
+	t.Helper()
+
+	um, err := GetModel(context.Background(), "test", Deps{
+		Secret:   []byte("test-secret"),
+		Store:    store.NewMemoryStore(),
+		Activity: store.NewMemoryActivityStore(time.Hour),
+		Tokens:   store.NewMemoryTokenStore(),
+	})
+	if err != nil {
+		t.Fatalf("GetModel returned an error: %v", err)
+	}
+	return um
+}
+
+func TestTokenSingleUseAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	um := newTestModel(t)
+
+	if _, err := um.RegisterUser(ctx, "user@example.com", "password", "127.0.0.1"); err != nil {
+		t.Fatalf("RegisterUser returned an error: %v", err)
+	}
+
+	token, err := um.IssueVerificationToken(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("IssueVerificationToken returned an error: %v", err)
+	}
+
+	if err = um.ConfirmVerification(ctx, token); err != nil {
+		t.Fatalf("ConfirmVerification returned an error: %v", err)
+	}
+
+	if err = um.ConfirmVerification(ctx, token); err != ErrInvalidToken {
+		t.Fatalf("expected ErrInvalidToken on a reused token, got: %v", err)
+	}
+
+	resetToken, err := um.IssueResetToken(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("IssueResetToken returned an error: %v", err)
+	}
+
+	// Force the token to look expired without sleeping in the test.
+	expired, found, err := um.tokens.Get(ctx, hashToken(resetToken))
+	if err != nil || !found {
+		t.Fatalf("expected to find the freshly issued reset token, found=%v err=%v", found, err)
+	}
+	expired.TTL = time.Now().Add(-time.Minute).Unix()
+	if err = um.tokens.Put(ctx, expired); err != nil {
+		t.Fatalf("Put returned an error: %v", err)
+	}
+
+	if err = um.ResetPassword(ctx, resetToken, "newpassword"); err != ErrInvalidToken {
+		t.Fatalf("expected ErrInvalidToken on an expired token, got: %v", err)
+	}
+}
+
+func TestMigrateLegacyLogsOnEveryPersist(t *testing.T) {
+	ctx := context.Background()
+	um := newTestModel(t)
+
+	legacyLogs, err := json.Marshal(map[string][]*LogLine{
+		CActivityAccountType: {
+			{Ts: 1, Ip: "127.0.0.1", LogType: CActivityAccountType, Desc: "registered"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal returned an error: %v", err)
+	}
+
+	if err = um.store.Put(ctx, "legacy@example.com", store.Item{
+		"uid":     "legacy@example.com",
+		"key":     um.HashPassword("password"),
+		"enabled": "1",
+		"logs":    string(legacyLogs),
+	}); err != nil {
+		t.Fatalf("Put returned an error: %v", err)
+	}
+
+	user := um.AdminGetUserInfoByID(ctx, "legacy@example.com")
+	if user == nil {
+		t.Fatal("expected to find the seeded legacy user")
+	}
+
+	// DisableUser doesn't touch activity directly; it should still migrate
+	// the legacy blob into the activity store before it persists.
+	if !user.DisableUser(ctx) {
+		t.Fatal("DisableUser reported failure")
+	}
+
+	activity, _, err := user.GetAllActivity(ctx, "", 10, "")
+	if err != nil {
+		t.Fatalf("GetAllActivity returned an error: %v", err)
+	}
+	if len(activity) != 1 {
+		t.Fatalf("expected the legacy entry to have migrated, got %d entries", len(activity))
+	}
+
+	item, found, err := um.store.Get(ctx, "legacy@example.com", true)
+	if err != nil || !found {
+		t.Fatalf("expected to find the persisted row, found=%v err=%v", found, err)
+	}
+	if _, stillPresent := item["logs"]; stillPresent {
+		t.Fatal("expected the legacy \"logs\" attribute to be dropped after migration")
+	}
+}
+
+func TestTOTPEnrollConfirmVerifyAndReplay(t *testing.T) {
+	ctx := context.Background()
+	um := newTestModel(t)
+
+	user, err := um.RegisterUser(ctx, "mfa@example.com", "password", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("RegisterUser returned an error: %v", err)
+	}
+
+	secret, _, err := user.EnrollTOTP(ctx)
+	if err != nil {
+		t.Fatalf("EnrollTOTP returned an error: %v", err)
+	}
+
+	confirmCode, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatalf("totp.GenerateCode returned an error: %v", err)
+	}
+
+	if _, err = user.ConfirmTOTP(ctx, confirmCode); err != nil {
+		t.Fatalf("ConfirmTOTP returned an error: %v", err)
+	}
+
+	// Logging in now requires a second factor: GetUserInfo must hand back a
+	// challenge instead of the user.
+	if loggedIn, challenge := um.GetUserInfo(ctx, "mfa@example.com", "password"); loggedIn != nil || challenge == "" {
+		t.Fatalf("expected a challenge and no user once MFA is enabled, got user=%v challenge=%q", loggedIn, challenge)
+	}
+
+	// The code used to confirm enrollment must not be usable to log in.
+	_, challenge := um.GetUserInfo(ctx, "mfa@example.com", "password")
+	if loggedIn := um.VerifyMFA(ctx, "mfa@example.com", challenge, confirmCode); loggedIn != nil {
+		t.Fatal("expected the confirm-enrollment code to be rejected as a replay")
+	}
+
+	// A code from the next window hasn't been seen before and must work.
+	counter := uint64(time.Now().Unix() / 30)
+	nextCode, err := hotp.GenerateCodeCustom(secret, counter+1, hotp.ValidateOpts{
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		t.Fatalf("hotp.GenerateCodeCustom returned an error: %v", err)
+	}
+
+	_, challenge = um.GetUserInfo(ctx, "mfa@example.com", "password")
+	loggedIn := um.VerifyMFA(ctx, "mfa@example.com", challenge, nextCode)
+	if loggedIn == nil {
+		t.Fatal("expected a fresh TOTP code to complete the login")
+	}
+
+	// Replaying that same code against a new challenge must now fail too.
+	_, challenge = um.GetUserInfo(ctx, "mfa@example.com", "password")
+	if loggedIn = um.VerifyMFA(ctx, "mfa@example.com", challenge, nextCode); loggedIn != nil {
+		t.Fatal("expected a reused TOTP code to be rejected")
+	}
+}
+
+func TestVerifyRecoveryCodeIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	um := newTestModel(t)
+
+	user, err := um.RegisterUser(ctx, "recovery@example.com", "password", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("RegisterUser returned an error: %v", err)
+	}
+
+	secret, _, err := user.EnrollTOTP(ctx)
+	if err != nil {
+		t.Fatalf("EnrollTOTP returned an error: %v", err)
+	}
+	confirmCode, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatalf("totp.GenerateCode returned an error: %v", err)
+	}
+	recoveryCodes, err := user.ConfirmTOTP(ctx, confirmCode)
+	if err != nil {
+		t.Fatalf("ConfirmTOTP returned an error: %v", err)
+	}
+	if len(recoveryCodes) == 0 {
+		t.Fatal("expected ConfirmTOTP to mint recovery codes")
+	}
+
+	_, challenge := um.GetUserInfo(ctx, "recovery@example.com", "password")
+	if loggedIn := um.VerifyRecoveryCode(ctx, "recovery@example.com", challenge, recoveryCodes[0]); loggedIn == nil {
+		t.Fatal("expected the recovery code to complete the login")
+	}
+
+	_, challenge = um.GetUserInfo(ctx, "recovery@example.com", "password")
+	if loggedIn := um.VerifyRecoveryCode(ctx, "recovery@example.com", challenge, recoveryCodes[0]); loggedIn != nil {
+		t.Fatal("expected the recovery code to be single-use")
+	}
+}